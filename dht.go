@@ -0,0 +1,158 @@
+package dht
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	kb "github.com/libp2p/go-libp2p-kbucket"
+
+	"github.com/jbenet/goprocess"
+
+	logging "github.com/ipfs/go-log"
+
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+
+	"github.com/libp2p/go-libp2p-kad-dht/reducer"
+)
+
+var logger = logging.Logger("dht")
+
+// Option is a DHT constructor option, applied to an IpfsDHT during New.
+type Option func(*IpfsDHT) error
+
+// protoMessenger is the subset of *pb.ProtocolMessenger's behavior the read and repair-on-read paths (routing.go,
+// repair.go) need. It's an interface rather than a direct reference to *pb.ProtocolMessenger so tests can substitute
+// a fake instead of having to drive a real network messenger.
+type protoMessenger interface {
+	GetValue(ctx context.Context, p peer.ID, key string) (*recpb.Record, []*peer.AddrInfo, error)
+	PutValue(ctx context.Context, p peer.ID, rec *recpb.Record) error
+}
+
+// Mode describes whether the DHT answers queries (ModeServer) or only issues them (ModeClient). It's exported so
+// applications can write their own ModePolicy and interpret EvtDHTModeChanged.From/To without reaching into an
+// unexported type they can't even spell.
+type Mode int
+
+const (
+	ModeServer Mode = iota
+	ModeClient
+)
+
+// IpfsDHT is a Kademlia-like structure for storing and retrieving values across the network, including peer routing
+// information. It's used both for DHT protocol handlers and as an ambient network overlay to improve connectivity.
+type IpfsDHT struct {
+	host      host.Host
+	self      peer.ID
+	peerstore peerstore.Peerstore
+
+	routingTable   *kb.RoutingTable
+	protoMessenger protoMessenger
+
+	ctx  context.Context
+	proc goprocess.Process
+
+	protocols []protocol.ID
+
+	// auto reports whether the DHT was constructed with ModeAuto: reachability observations only drive client/server
+	// switches (see handleLocalReachabilityChangedEvent) when this is true.
+	auto bool
+
+	modeLk sync.Mutex
+	mode   Mode
+
+	// triggerRtRefresh is read by the routing table refresh loop and written (non-blocking) by fixRTIfNeeded.
+	triggerRtRefresh chan chan<- error
+	// triggerSelfLookup is read by the self-lookup loop and written (non-blocking) whenever our own addresses change.
+	triggerSelfLookup chan chan<- error
+
+	plk sync.Mutex
+
+	smlk   sync.Mutex
+	strmap map[peer.ID]*messageSender
+
+	// reducer folds the values GetValue/SearchValue collect in their quorum step, letting disagreeing records be
+	// merged instead of just selected among. Set via WithReducer. There is no Select fallback: while it is nil,
+	// GetValue returns an error and SearchValue closes its channel without a value.
+	reducer reducer.Reducer
+
+	// maxRepairPuts bounds how many peers a single repair-on-read PUT touches; see WithMaxRepairPuts.
+	maxRepairPuts int
+
+	// modePolicy translates EvtLocalReachabilityChanged observations into client/server mode transitions; see
+	// WithModePolicy. Left nil, newSubscriberNotifiee defaults it to a HysteresisPolicy.
+	modePolicy ModePolicy
+
+	// routingTableEvents controls whether EvtDHTRoutingTablePeerAdded/Removed/Changed are emitted on the host's
+	// event bus; see WithRoutingTableEvents. Defaults to false.
+	routingTableEvents bool
+
+	// streamManagerWorkers sets how many workers drain the messageSender invalidation queue fed by
+	// subscriberNotifee.Disconnected and invalidateMessageSender; see WithStreamManagerWorkers. Left at 0,
+	// newMsInvalidator defaults it to DefaultStreamManagerWorkers.
+	streamManagerWorkers int
+}
+
+// Context returns the DHT's background context, the one peerFound, peerStoppedDHT and friends issue their own calls
+// against when they aren't handling a request with its own context.
+func (dht *IpfsDHT) Context() context.Context {
+	return dht.ctx
+}
+
+// Process returns the DHT's goprocess, closed when the DHT is shutting down.
+func (dht *IpfsDHT) Process() goprocess.Process {
+	return dht.proc
+}
+
+// getMode returns the DHT's current client/server mode.
+func (dht *IpfsDHT) getMode() Mode {
+	dht.modeLk.Lock()
+	defer dht.modeLk.Unlock()
+	return dht.mode
+}
+
+// setMode switches the DHT between client and server mode.
+func (dht *IpfsDHT) setMode(m Mode) error {
+	dht.modeLk.Lock()
+	defer dht.modeLk.Unlock()
+	dht.mode = m
+	return nil
+}
+
+// fixRTIfNeeded nudges the routing table refresh loop without blocking the caller: if a refresh is already pending,
+// this is a no-op.
+func (dht *IpfsDHT) fixRTIfNeeded() {
+	select {
+	case dht.triggerRtRefresh <- nil:
+	default:
+	}
+}
+
+// peerFound signals the routing table that we've witnessed p, adding it if there's room (or it displaces a
+// less-useful peer) and it speaks the DHT protocol.
+func (dht *IpfsDHT) peerFound(ctx context.Context, p peer.ID, queryPeer bool) {
+	if p == dht.self {
+		return
+	}
+
+	if valid, err := dht.validRTPeer(p); err != nil {
+		logger.Errorf("could not check peerstore for protocol support: err: %s", err)
+		return
+	} else if !valid {
+		return
+	}
+
+	if _, err := dht.routingTable.TryAddPeer(p, queryPeer, false); err != nil {
+		logger.Debugf("failed to add peer %s to routing table: %s", p, err)
+	}
+}
+
+// peerStoppedDHT signals the routing table that p no longer speaks the DHT protocol and should be evicted if present.
+func (dht *IpfsDHT) peerStoppedDHT(ctx context.Context, p peer.ID) {
+	logger.Debugf("peer %s stopped dht", p)
+	dht.routingTable.RemovePeer(p)
+}
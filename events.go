@@ -0,0 +1,43 @@
+package dht
+
+import "github.com/libp2p/go-libp2p-core/peer"
+
+// EvtDHTModeChanged is emitted on the host's event bus whenever the DHT actually transitions between client and
+// server mode, as decided by the configured ModePolicy. It is distinct from EvtLocalReachabilityChanged: many
+// reachability observations can come and go (see HysteresisPolicy) without ever producing one of these.
+type EvtDHTModeChanged struct {
+	From Mode
+	To   Mode
+}
+
+// EvtDHTRoutingTablePeerAdded is emitted when a peer is added to the DHT's routing table.
+type EvtDHTRoutingTablePeerAdded struct {
+	Peer peer.ID
+}
+
+// EvtDHTRoutingTablePeerRemoved is emitted when a peer is evicted from the DHT's routing table, whether because it
+// stopped speaking the DHT protocol or was displaced by the routing table itself. Disconnecting alone does not
+// remove a peer from the table.
+type EvtDHTRoutingTablePeerRemoved struct {
+	Peer peer.ID
+}
+
+// EvtDHTRoutingTableChanged is emitted after PeerAdded/PeerRemoved events with the routing table's resulting size and
+// approximate bucket count (the number of distinct common-prefix lengths among its peers), so a subscriber that only
+// cares about aggregate shape doesn't have to track individual peers itself. A burst of PeerAdded/PeerRemoved events
+// can yield a single EvtDHTRoutingTableChanged.
+type EvtDHTRoutingTableChanged struct {
+	Size    int
+	Buckets int
+}
+
+// WithRoutingTableEvents controls whether the DHT emits EvtDHTRoutingTablePeerAdded, EvtDHTRoutingTablePeerRemoved and
+// EvtDHTRoutingTableChanged on the host's event bus. It defaults to false: most deployments poll
+// RoutingTable().ListPeers() if they need this at all, and wiring up the emitters costs a bounded buffer per DHT
+// instance that callers who don't subscribe shouldn't have to pay for.
+func WithRoutingTableEvents(enable bool) Option {
+	return func(dht *IpfsDHT) error {
+		dht.routingTableEvents = enable
+		return nil
+	}
+}
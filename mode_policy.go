@@ -0,0 +1,124 @@
+package dht
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// ReachabilitySample is one observation of EvtLocalReachabilityChanged, timestamped with when it was received, so a
+// ModePolicy can reason about how long a reachability value has held rather than just the latest flap.
+type ReachabilitySample struct {
+	Reachability network.Reachability
+	At           time.Time
+}
+
+// ModePolicy decides how the DHT should respond to a local reachability observation. It is given the DHT's current
+// mode, the event that just arrived, and the most recent samples the subscriberNotifee has observed, including this
+// one (at most 64, oldest first). It returns the mode the DHT should end up in and how long to wait before applying
+// it; a zero delay applies immediately. Every later event cancels a pending (delay > 0) decision, and that event's own
+// Decide result takes its place, so a pending target is applied only if no other event arrives before its delay
+// elapses.
+type ModePolicy interface {
+	Decide(current Mode, evt event.EvtLocalReachabilityChanged, history []ReachabilitySample) (target Mode, delay time.Duration)
+}
+
+// WithModePolicy sets the policy used to translate EvtLocalReachabilityChanged observations into client/server mode
+// transitions. It has no effect unless the DHT is running in ModeAuto.
+func WithModePolicy(p ModePolicy) Option {
+	return func(dht *IpfsDHT) error {
+		dht.modePolicy = p
+		return nil
+	}
+}
+
+// StaticPolicy reproduces the DHT's original behavior: every reachability event is acted on immediately, with no
+// debouncing. It exists for callers who relied on that immediacy and would rather eat the churn on a flaky NAT than
+// add latency to the client/server switch.
+type StaticPolicy struct{}
+
+func (StaticPolicy) Decide(current Mode, evt event.EvtLocalReachabilityChanged, _ []ReachabilitySample) (Mode, time.Duration) {
+	switch evt.Reachability {
+	case network.ReachabilityPublic:
+		return ModeServer, 0
+	case network.ReachabilityPrivate, network.ReachabilityUnknown:
+		return ModeClient, 0
+	default:
+		return current, 0
+	}
+}
+
+var _ ModePolicy = StaticPolicy{}
+
+// HysteresisPolicy is the default ModePolicy. It requires N consecutive ReachabilityPublic observations spanning at
+// least MinPublicDuration before promoting to server mode, and requires MinPrivateDuration of continuous
+// ReachabilityPrivate before demoting back to client. This trades a slower reaction for not thrashing modes (and the
+// listen/advertise churn that comes with it) on a NAT that flaps reachability every few seconds.
+type HysteresisPolicy struct {
+	// N is the number of trailing consecutive public samples required before promotion. Values <= 1 require only
+	// the triggering sample.
+	N int
+	// MinPublicDuration is how long the trailing run of public samples must span before promoting to server.
+	MinPublicDuration time.Duration
+	// MinPrivateDuration is how long reachability must have been continuously private before demoting to client.
+	MinPrivateDuration time.Duration
+}
+
+func (p HysteresisPolicy) Decide(current Mode, evt event.EvtLocalReachabilityChanged, history []ReachabilitySample) (Mode, time.Duration) {
+	switch evt.Reachability {
+	case network.ReachabilityPublic:
+		if current == ModeServer {
+			return ModeServer, 0
+		}
+
+		n := p.N
+		if n <= 0 {
+			n = 1
+		}
+		run := trailingRun(history, network.ReachabilityPublic)
+		if len(run) < n {
+			return current, 0
+		}
+
+		span := run[len(run)-1].At.Sub(run[0].At)
+		if span < p.MinPublicDuration {
+			// the run qualifies on count but not yet on duration; report the eventual target so the caller
+			// schedules a timer for the remaining wait instead of discarding it as a no-op.
+			return ModeServer, p.MinPublicDuration - span
+		}
+		return ModeServer, 0
+
+	case network.ReachabilityPrivate:
+		if current == ModeClient {
+			return ModeClient, 0
+		}
+
+		run := trailingRun(history, network.ReachabilityPrivate)
+		if len(run) == 0 {
+			return current, 0
+		}
+		span := run[len(run)-1].At.Sub(run[0].At)
+		if span < p.MinPrivateDuration {
+			// same reasoning as the public case above: report ModeClient so the caller actually schedules the
+			// remaining wait rather than treating it as "no transition needed".
+			return ModeClient, p.MinPrivateDuration - span
+		}
+		return ModeClient, 0
+
+	default:
+		// ReachabilityUnknown doesn't move us toward either mode on its own; it just breaks a trailing run.
+		return current, 0
+	}
+}
+
+var _ ModePolicy = HysteresisPolicy{}
+
+// trailingRun returns the longest suffix of history whose Reachability is all r, oldest first.
+func trailingRun(history []ReachabilitySample, r network.Reachability) []ReachabilitySample {
+	i := len(history)
+	for i > 0 && history[i-1].Reachability == r {
+		i--
+	}
+	return history[i:]
+}
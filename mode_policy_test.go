@@ -0,0 +1,153 @@
+package dht
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+func sampleAt(r network.Reachability, at time.Time) ReachabilitySample {
+	return ReachabilitySample{Reachability: r, At: at}
+}
+
+func TestTrailingRun(t *testing.T) {
+	base := time.Unix(0, 0)
+	history := []ReachabilitySample{
+		sampleAt(network.ReachabilityPrivate, base),
+		sampleAt(network.ReachabilityPublic, base.Add(time.Second)),
+		sampleAt(network.ReachabilityUnknown, base.Add(2*time.Second)),
+		sampleAt(network.ReachabilityPublic, base.Add(3*time.Second)),
+		sampleAt(network.ReachabilityPublic, base.Add(4*time.Second)),
+	}
+
+	run := trailingRun(history, network.ReachabilityPublic)
+	if len(run) != 2 {
+		t.Fatalf("expected a trailing run of 2, got %d", len(run))
+	}
+	if !run[0].At.Equal(base.Add(3 * time.Second)) {
+		t.Fatalf("expected the run to start at the sample after the Unknown break, got %s", run[0].At)
+	}
+
+	if run := trailingRun(history, network.ReachabilityPrivate); len(run) != 0 {
+		t.Fatalf("expected no trailing run of Private samples, got %d", len(run))
+	}
+
+	if run := trailingRun(nil, network.ReachabilityPublic); len(run) != 0 {
+		t.Fatalf("expected no run over an empty history, got %d", len(run))
+	}
+}
+
+func TestHysteresisPolicyDecidePromotion(t *testing.T) {
+	p := HysteresisPolicy{N: 3, MinPublicDuration: time.Minute, MinPrivateDuration: 30 * time.Second}
+	base := time.Unix(0, 0)
+
+	t.Run("stays on client until N consecutive public samples accumulate", func(t *testing.T) {
+		history := []ReachabilitySample{
+			sampleAt(network.ReachabilityPublic, base),
+			sampleAt(network.ReachabilityPublic, base.Add(time.Minute)),
+		}
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}
+
+		target, delay := p.Decide(ModeClient, evt, history)
+		if target != ModeClient || delay != 0 {
+			t.Fatalf("expected no transition with only 2 of 3 required samples, got (%v, %s)", target, delay)
+		}
+	})
+
+	t.Run("reports ModeServer with the remaining wait once the count is met but the duration isn't", func(t *testing.T) {
+		history := []ReachabilitySample{
+			sampleAt(network.ReachabilityPublic, base),
+			sampleAt(network.ReachabilityPublic, base.Add(10*time.Second)),
+			sampleAt(network.ReachabilityPublic, base.Add(20*time.Second)),
+		}
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}
+
+		target, delay := p.Decide(ModeClient, evt, history)
+		if target != ModeServer {
+			t.Fatalf("expected the eventual target to be reported while waiting on duration, got %v", target)
+		}
+		wantDelay := p.MinPublicDuration - 20*time.Second
+		if delay != wantDelay {
+			t.Fatalf("expected a delay of %s for the remaining wait, got %s", wantDelay, delay)
+		}
+	})
+
+	t.Run("promotes immediately once both the count and duration are satisfied", func(t *testing.T) {
+		history := []ReachabilitySample{
+			sampleAt(network.ReachabilityPublic, base),
+			sampleAt(network.ReachabilityPublic, base.Add(30*time.Second)),
+			sampleAt(network.ReachabilityPublic, base.Add(time.Minute)),
+		}
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}
+
+		target, delay := p.Decide(ModeClient, evt, history)
+		if target != ModeServer || delay != 0 {
+			t.Fatalf("expected an immediate promotion, got (%v, %s)", target, delay)
+		}
+	})
+
+	t.Run("is a no-op when already in server mode", func(t *testing.T) {
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}
+		target, delay := p.Decide(ModeServer, evt, nil)
+		if target != ModeServer || delay != 0 {
+			t.Fatalf("expected to stay in server mode, got (%v, %s)", target, delay)
+		}
+	})
+}
+
+func TestHysteresisPolicyDecideDemotion(t *testing.T) {
+	p := HysteresisPolicy{N: 3, MinPublicDuration: time.Minute, MinPrivateDuration: 30 * time.Second}
+	base := time.Unix(0, 0)
+
+	t.Run("reports ModeClient with the remaining wait before the private duration is met", func(t *testing.T) {
+		history := []ReachabilitySample{
+			sampleAt(network.ReachabilityPrivate, base),
+		}
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate}
+
+		target, delay := p.Decide(ModeServer, evt, history)
+		if target != ModeClient {
+			t.Fatalf("expected the eventual target to be ModeClient while waiting on duration, got %v", target)
+		}
+		if delay != p.MinPrivateDuration {
+			t.Fatalf("expected a delay of %s, got %s", p.MinPrivateDuration, delay)
+		}
+	})
+
+	t.Run("demotes immediately once the private duration is satisfied", func(t *testing.T) {
+		history := []ReachabilitySample{
+			sampleAt(network.ReachabilityPrivate, base),
+			sampleAt(network.ReachabilityPrivate, base.Add(30*time.Second)),
+		}
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate}
+
+		target, delay := p.Decide(ModeServer, evt, history)
+		if target != ModeClient || delay != 0 {
+			t.Fatalf("expected an immediate demotion, got (%v, %s)", target, delay)
+		}
+	})
+
+	t.Run("ReachabilityUnknown is a no-op", func(t *testing.T) {
+		evt := event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityUnknown}
+		target, delay := p.Decide(ModeServer, evt, nil)
+		if target != ModeServer || delay != 0 {
+			t.Fatalf("expected no transition, got (%v, %s)", target, delay)
+		}
+	})
+}
+
+func TestStaticPolicyDecide(t *testing.T) {
+	var p StaticPolicy
+
+	if target, delay := p.Decide(ModeClient, event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}, nil); target != ModeServer || delay != 0 {
+		t.Fatalf("expected an immediate switch to ModeServer, got (%v, %s)", target, delay)
+	}
+	if target, delay := p.Decide(ModeServer, event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate}, nil); target != ModeClient || delay != 0 {
+		t.Fatalf("expected an immediate switch to ModeClient, got (%v, %s)", target, delay)
+	}
+	if target, delay := p.Decide(ModeServer, event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityUnknown}, nil); target != ModeClient || delay != 0 {
+		t.Fatalf("expected Unknown to switch to ModeClient like Private, got (%v, %s)", target, delay)
+	}
+}
@@ -0,0 +1,106 @@
+package dht
+
+import (
+	"runtime"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultStreamManagerWorkers is used when WithStreamManagerWorkers is not set.
+var DefaultStreamManagerWorkers = runtime.NumCPU()
+
+// msInvalidationBacklog bounds how many pending invalidation jobs can queue before enqueue starts dropping them. It's
+// sized generously since a dropped job's messageSender is simply never invalidated by this queue; its callers have
+// already removed it from dht.strmap, so later requests for that peer don't reuse it.
+const msInvalidationBacklog = 1024
+
+// WithStreamManagerWorkers sets how many workers drain the messageSender invalidation queue fed by
+// subscriberNotifee.Disconnected and invalidateMessageSender. It defaults to runtime.NumCPU().
+func WithStreamManagerWorkers(n int) Option {
+	return func(dht *IpfsDHT) error {
+		dht.streamManagerWorkers = n
+		return nil
+	}
+}
+
+// msInvalidationJob is one messageSender queued for invalidation.
+type msInvalidationJob struct {
+	peer peer.ID
+	ms   *messageSender
+}
+
+// msInvalidator replaces the goroutine-per-disconnect pattern that used to back subscriberNotifee.Disconnected and
+// invalidateMessageSender with a bounded worker pool. Without it, a reconnect storm (NAT rebind, wifi roam) fans out
+// a goroutine per disconnecting peer, each blocked on that peer's messageSender lock; here disconnects enqueue a job
+// instead, and a fixed set of workers drains it, so only as many goroutines as there are workers ever block on a
+// contended lock at once.
+type msInvalidator struct {
+	dht  *IpfsDHT
+	jobs chan msInvalidationJob
+	stop chan struct{}
+}
+
+func newMsInvalidator(dht *IpfsDHT) *msInvalidator {
+	workers := dht.streamManagerWorkers
+	if workers <= 0 {
+		workers = DefaultStreamManagerWorkers
+	}
+
+	inv := &msInvalidator{
+		dht:  dht,
+		jobs: make(chan msInvalidationJob, msInvalidationBacklog),
+		stop: make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		go inv.worker()
+	}
+
+	return inv
+}
+
+// enqueue queues ms for invalidation.
+func (inv *msInvalidator) enqueue(p peer.ID, ms *messageSender) {
+	select {
+	case inv.jobs <- msInvalidationJob{peer: p, ms: ms}:
+	case <-inv.stop:
+	default:
+		logger.Warnf("messageSender invalidation queue full, dropping job for %s", p)
+	}
+}
+
+func (inv *msInvalidator) worker() {
+	for {
+		select {
+		case job := <-inv.jobs:
+			inv.process(job)
+		case <-inv.stop:
+			return
+		}
+	}
+}
+
+// process acquires job.ms's lock and invalidates it. ms.lk is a ctx-aware Lock(ctx) error/Unlock() pair, not a
+// sync.Mutex, so it has no real TryLock to attempt a non-blocking acquisition with; faking one by calling Lock with
+// an already-cancelled context is racy -- when the lock is actually free, Lock's internal select between granting it
+// and <-ctx.Done() can still resolve to the cancelled branch, reporting a spurious failure under no contention at
+// all. Blocking on dht.Context() here, as Disconnected's old per-goroutine code did, is correct and still bounded:
+// it's the fixed-size worker pool, not a per-call non-blocking trick, that caps how many invalidations can be
+// waiting on a contended lock at once.
+//
+// This intentionally does not add a lock-free idle fast path that marks ms.invalid via an atomic without going
+// through ms.lk at all: messageSender exposes no atomic "last used" state to check idleness against, and setting
+// ms.invalid outside the lock it's otherwise only ever read/written under would just reintroduce the kind of race
+// the lock exists to prevent (a concurrent sender could observe invalid flip mid-send). That fast path is out of
+// scope here; process always goes through the real lock.
+func (inv *msInvalidator) process(job msInvalidationJob) {
+	if err := job.ms.lk.Lock(inv.dht.Context()); err != nil {
+		return
+	}
+	defer job.ms.lk.Unlock()
+	job.ms.invalidate()
+}
+
+func (inv *msInvalidator) close() {
+	close(inv.stop)
+}
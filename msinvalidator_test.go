@@ -0,0 +1,50 @@
+package dht
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestMsInvalidatorEnqueueDropsOnFullBacklog(t *testing.T) {
+	inv := &msInvalidator{
+		jobs: make(chan msInvalidationJob, 1),
+		stop: make(chan struct{}),
+	}
+
+	inv.enqueue(peer.ID("p1"), &messageSender{})
+	// the backlog (size 1) is already full, so this one should be dropped rather than block.
+	inv.enqueue(peer.ID("p2"), &messageSender{})
+
+	if n := len(inv.jobs); n != 1 {
+		t.Fatalf("expected exactly 1 queued job, got %d", n)
+	}
+
+	job := <-inv.jobs
+	if job.peer != peer.ID("p1") {
+		t.Fatalf("expected the first enqueued job to survive, got job for %s", job.peer)
+	}
+}
+
+func TestMsInvalidatorEnqueueAfterCloseDoesNotBlock(t *testing.T) {
+	inv := &msInvalidator{
+		jobs: make(chan msInvalidationJob, 1),
+		stop: make(chan struct{}),
+	}
+	inv.close()
+
+	// whether this lands in jobs or hits the stop case is a race (both are ready), but either way enqueue must
+	// return rather than panic or block once stop is closed.
+	done := make(chan struct{})
+	go func() {
+		inv.enqueue(peer.ID("p1"), &messageSender{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue did not return after stop was closed")
+	}
+}
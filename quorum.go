@@ -0,0 +1,64 @@
+package dht
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/libp2p/go-libp2p-kad-dht/reducer"
+)
+
+// WithReducer sets the Reducer used to fold the values GetValue/SearchValue (see routing.go) collect from a key's
+// closest peers once they've gathered a quorum. Unlike a plain record.Validator-based Select, it can also merge
+// disagreeing records (see the reducer package's MergingReducer family) and feed the result to repairOnRead.
+// GetValue/SearchValue have no other way to pick a value: without a reducer, reduceAndRepair returns an error.
+func WithReducer(r reducer.Reducer) Option {
+	return func(dht *IpfsDHT) error {
+		dht.reducer = r
+		return nil
+	}
+}
+
+// peerValue pairs a value fetched from a peer with the peer it came from, which is what repairOnRead needs in order
+// to PUT a merged record back to whoever held a superseded one.
+type peerValue struct {
+	from  peer.ID
+	value []byte
+}
+
+// reduceAndRepair is the quorum-processing step for GetValue/SearchValue: given the peer values their iterative
+// lookup already collected, it folds them through dht.reducer, and whenever the reducer reports a brand-new merged
+// value (index -1, see the reducer package's MergingReducer family), hands every peer whose value disagreed with it
+// to repairOnRead so the merged record gets written back.
+func (dht *IpfsDHT) reduceAndRepair(key string, vals []peerValue) ([]byte, error) {
+	if dht.reducer == nil {
+		return nil, fmt.Errorf("no reducer configured for key %s", key)
+	}
+
+	raw := make([][]byte, len(vals))
+	for i, v := range vals {
+		raw[i] = v.value
+	}
+
+	merged, idx, err := dht.reducer.Reduce(key, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx != -1 {
+		// the reducer selected one of the inputs outright rather than producing a new value; repair only runs for
+		// merged values, so peers holding a different input are left as they are.
+		return merged, nil
+	}
+
+	superseded := make([]repairCandidate, 0, len(vals))
+	for _, v := range vals {
+		if !bytes.Equal(v.value, merged) {
+			superseded = append(superseded, repairCandidate{from: v.from, value: v.value})
+		}
+	}
+	dht.repairOnRead(key, merged, superseded)
+
+	return merged, nil
+}
@@ -0,0 +1,142 @@
+package dht
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+)
+
+// fakeProtoMessenger is a protoMessenger that just records which peers PutValue was called with, so tests can assert
+// on repairOnRead's fan-out without driving a real network messenger.
+type fakeProtoMessenger struct {
+	mu   sync.Mutex
+	puts []peer.ID
+}
+
+func (f *fakeProtoMessenger) GetValue(ctx context.Context, p peer.ID, key string) (*recpb.Record, []*peer.AddrInfo, error) {
+	return nil, nil, nil
+}
+
+func (f *fakeProtoMessenger) PutValue(ctx context.Context, p peer.ID, rec *recpb.Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.puts = append(f.puts, p)
+	return nil
+}
+
+func (f *fakeProtoMessenger) putsSoFar() []peer.ID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]peer.ID, len(f.puts))
+	copy(out, f.puts)
+	return out
+}
+
+// waitForPuts polls fakeProtoMessenger until it has seen n puts (repairOnRead fires them in its own goroutine) or
+// fails the test after a short timeout.
+func waitForPuts(t *testing.T, f *fakeProtoMessenger, n int) []peer.ID {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		puts := f.putsSoFar()
+		if len(puts) >= n {
+			return puts
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d puts, got %d", n, len(puts))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// alwaysMergeReducer reports every Reduce call as a brand-new merged value (index -1), which is what drives
+// reduceAndRepair's repair path regardless of what values it's given.
+type alwaysMergeReducer struct {
+	merged []byte
+}
+
+func (alwaysMergeReducer) Validate(key string, value []byte) error { return nil }
+
+func (r alwaysMergeReducer) Reduce(key string, values [][]byte) ([]byte, int, error) {
+	return r.merged, -1, nil
+}
+
+func TestReduceAndRepairPutsOnlySupersededPeersWithinMaxRepairPuts(t *testing.T) {
+	fpm := &fakeProtoMessenger{}
+	dht := &IpfsDHT{
+		ctx:            context.Background(),
+		protoMessenger: fpm,
+		reducer:        alwaysMergeReducer{merged: []byte("merged")},
+		maxRepairPuts:  2,
+	}
+
+	vals := []peerValue{
+		{from: peer.ID("agrees"), value: []byte("merged")},
+		{from: peer.ID("stale1"), value: []byte("old1")},
+		{from: peer.ID("stale2"), value: []byte("old2")},
+		{from: peer.ID("stale3"), value: []byte("old3")},
+	}
+
+	merged, err := dht.reduceAndRepair("k", vals)
+	if err != nil {
+		t.Fatalf("reduceAndRepair returned an error: %s", err)
+	}
+	if string(merged) != "merged" {
+		t.Fatalf("expected the merged value back, got %q", merged)
+	}
+
+	puts := waitForPuts(t, fpm, 2)
+	if len(puts) != 2 {
+		t.Fatalf("expected exactly 2 puts (bounded by maxRepairPuts), got %d: %v", len(puts), puts)
+	}
+
+	sort.Slice(puts, func(i, j int) bool { return puts[i] < puts[j] })
+	if puts[0] != peer.ID("stale1") || puts[1] != peer.ID("stale2") {
+		t.Fatalf("expected puts to stale1 and stale2 only, got %v", puts)
+	}
+
+	// give any unexpected extra put (e.g. to "agrees" or "stale3") a moment to show up before asserting it didn't.
+	time.Sleep(10 * time.Millisecond)
+	if puts := fpm.putsSoFar(); len(puts) != 2 {
+		t.Fatalf("expected no further puts beyond the bound, got %d: %v", len(puts), puts)
+	}
+}
+
+func TestReduceAndRepairSkipsRepairWhenReducerSelectsAnInput(t *testing.T) {
+	fpm := &fakeProtoMessenger{}
+	dht := &IpfsDHT{
+		ctx:            context.Background(),
+		protoMessenger: fpm,
+		reducer:        selectFirstReducer{},
+		maxRepairPuts:  6,
+	}
+
+	vals := []peerValue{
+		{from: peer.ID("p1"), value: []byte("v1")},
+		{from: peer.ID("p2"), value: []byte("v2")},
+	}
+
+	if _, err := dht.reduceAndRepair("k", vals); err != nil {
+		t.Fatalf("reduceAndRepair returned an error: %s", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if puts := fpm.putsSoFar(); len(puts) != 0 {
+		t.Fatalf("expected no repair puts when the reducer selected an input outright, got %v", puts)
+	}
+}
+
+// selectFirstReducer always reports the first input as selected (index 0), the way a plain record.Validator-based
+// Select would when every input already agrees.
+type selectFirstReducer struct{}
+
+func (selectFirstReducer) Validate(key string, value []byte) error { return nil }
+
+func (selectFirstReducer) Reduce(key string, values [][]byte) ([]byte, int, error) {
+	return values[0], 0, nil
+}
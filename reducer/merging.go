@@ -0,0 +1,207 @@
+package reducer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Merge combines a set of candidate values for a key into a single record. It
+// is given the raw values that Validate has already accepted. If the merged
+// result is not equal to any of the inputs, callers should treat it as new and
+// propagate it back to the network (see MergingReducer.Reduce).
+type Merge func(key string, values [][]byte) ([]byte, error)
+
+// MergingReducer adapts a Merge function into a Reducer. Unlike the
+// select-only reducers in reducer.go, Reduce here may legitimately return -1:
+// that happens whenever Merge produces a value that differs from every input,
+// signalling to the caller that the fused record should be written back to
+// the peers that only held a superseded value.
+type MergingReducer struct {
+	Validator interface {
+		Validate(key string, value []byte) error
+	}
+	Merge Merge
+}
+
+func (r MergingReducer) Validate(key string, value []byte) error {
+	return r.Validator.Validate(key, value)
+}
+
+func (r MergingReducer) Reduce(key string, values [][]byte) ([]byte, int, error) {
+	if len(values) == 0 {
+		return nil, -1, errors.New("can't reduce no values")
+	}
+
+	merged, err := r.Merge(key, values)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	for i, v := range values {
+		if bytes.Equal(v, merged) {
+			return v, i, nil
+		}
+	}
+
+	return merged, -1, nil
+}
+
+var _ Reducer = MergingReducer{}
+
+// ipnsEntry is the minimal shape of an IPNS record that IpnsMergeReducer needs
+// in order to compare sequence numbers. The DHT's ipns.Validator has already
+// verified the signature and validity of every value passed to Reduce, so
+// IpnsMergeReducer only needs to pick the winner and reconcile validity.
+type ipnsEntry interface {
+	Seq() uint64
+	ValidityEOS() bool
+}
+
+// IpnsMergeReducer merges IPNS records by sequence number. It never fabricates
+// a new signed record (IPNS entries are signed by the publisher's private
+// key, which the DHT does not have); instead it selects a winner among the
+// inputs, so Reduce always returns a matching index rather than -1. The
+// "merge" is in intersecting validity: an entry that has already reached the
+// end of its validity window (ValidityEOS) loses to any entry that hasn't,
+// regardless of sequence number, since handing out an entry IPNS itself has
+// marked unusable would just push a stale record back onto the network; ties
+// within the same validity state are broken by the highest sequence number.
+type IpnsMergeReducer struct {
+	Reducer
+	Decode func(value []byte) (ipnsEntry, error)
+}
+
+func (r IpnsMergeReducer) Reduce(key string, values [][]byte) ([]byte, int, error) {
+	best := -1
+	var bestSeq uint64
+	var bestExpired bool
+
+	for i, v := range values {
+		entry, err := r.Decode(v)
+		if err != nil {
+			continue
+		}
+
+		expired := entry.ValidityEOS()
+		better := best == -1 ||
+			(bestExpired && !expired) ||
+			(expired == bestExpired && entry.Seq() > bestSeq)
+		if better {
+			best = i
+			bestSeq = entry.Seq()
+			bestExpired = expired
+		}
+	}
+
+	if best == -1 {
+		return nil, -1, errors.New("no valid ipns entry to merge")
+	}
+
+	return values[best], best, nil
+}
+
+var _ Reducer = IpnsMergeReducer{}
+
+// VectorClock is a logical clock keyed by replica ID. Records merged by
+// LWWReducer carry one alongside their payload so concurrent writes from
+// different replicas can be reconciled deterministically instead of
+// last-writer-wins clobbering one of them.
+type VectorClock map[string]uint64
+
+// Merge returns the pointwise max of two clocks.
+func (vc VectorClock) Merge(other VectorClock) VectorClock {
+	out := make(VectorClock, len(vc)+len(other))
+	for id, t := range vc {
+		out[id] = t
+	}
+	for id, t := range other {
+		if t > out[id] {
+			out[id] = t
+		}
+	}
+	return out
+}
+
+// LWWReducer merges records framed as a VectorClock followed by an
+// application payload, encoded via Decode/Encode. The merged clock is the
+// pointwise max of every input clock, and the merged payload is whatever
+// PickPayload chooses given every input's clock and payload; Reduce itself
+// does not drop inputs whose clock is dominated by another. Because the merged record's clock is generally
+// not equal to any single input's clock, Reduce will usually return -1,
+// which is the point: it lets the DHT repair every peer holding a
+// conflicting branch.
+type LWWReducer struct {
+	Decode      func(value []byte) (VectorClock, []byte, error)
+	Encode      func(clock VectorClock, payload []byte) ([]byte, error)
+	PickPayload func(clocks []VectorClock, payloads [][]byte) []byte
+}
+
+func (r LWWReducer) Validate(key string, value []byte) error {
+	_, _, err := r.Decode(value)
+	return err
+}
+
+func (r LWWReducer) Reduce(key string, values [][]byte) ([]byte, int, error) {
+	if len(values) == 0 {
+		return nil, -1, errors.New("can't reduce no values")
+	}
+
+	clocks := make([]VectorClock, len(values))
+	payloads := make([][]byte, len(values))
+	merged := VectorClock{}
+
+	for i, v := range values {
+		clock, payload, err := r.Decode(v)
+		if err != nil {
+			return nil, -1, err
+		}
+		clocks[i] = clock
+		payloads[i] = payload
+		merged = merged.Merge(clock)
+	}
+
+	payload := r.PickPayload(clocks, payloads)
+	out, err := r.Encode(merged, payload)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	for i, v := range values {
+		if bytes.Equal(v, out) {
+			return v, i, nil
+		}
+	}
+
+	return out, -1, nil
+}
+
+var _ Reducer = LWWReducer{}
+
+// EncodeVectorClock is a convenience helper producing the
+// length-prefixed-entries encoding expected by the default Decode/Encode
+// pairing used in tests: one varint pair (len(id), id bytes) followed by a
+// varint timestamp, per entry, sorted by id. The sort matters: LWWReducer.Reduce
+// compares encoded output byte-for-byte to decide whether a merge produced a
+// genuinely new value, and Go's map iteration order is randomized, so without
+// it two calls encoding the same clock could produce different bytes and
+// spuriously report a merged-but-unchanged clock as new.
+func EncodeVectorClock(vc VectorClock) []byte {
+	ids := make([]string, 0, len(vc))
+	for id := range vc {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	buf := make([]byte, 0, len(vc)*16)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, id := range ids {
+		n := binary.PutUvarint(tmp, uint64(len(id)))
+		buf = append(buf, tmp[:n]...)
+		buf = append(buf, id...)
+		n = binary.PutUvarint(tmp, vc[id])
+		buf = append(buf, tmp[:n]...)
+	}
+	return buf
+}
@@ -0,0 +1,212 @@
+package reducer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+type noopValidator struct{}
+
+func (noopValidator) Validate(_ string, _ []byte) error { return nil }
+
+func TestMergingReducerReduce(t *testing.T) {
+	upper := func(_ string, values [][]byte) ([]byte, error) {
+		return bytes.ToUpper(values[0]), nil
+	}
+
+	r := MergingReducer{Validator: noopValidator{}, Merge: upper}
+
+	t.Run("selects an input that already matches the merge", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{[]byte("A"), []byte("a")})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != 0 {
+			t.Fatalf("expected index 0, got %d", idx)
+		}
+		if !bytes.Equal(out, []byte("A")) {
+			t.Fatalf("expected %q, got %q", "A", out)
+		}
+	})
+
+	t.Run("reports -1 when the merge produces a genuinely new value", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{[]byte("a"), []byte("b")})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != -1 {
+			t.Fatalf("expected index -1, got %d", idx)
+		}
+		if !bytes.Equal(out, []byte("A")) {
+			t.Fatalf("expected %q, got %q", "A", out)
+		}
+	})
+}
+
+type fakeIpnsEntry struct {
+	seq     uint64
+	expired bool
+}
+
+func (e fakeIpnsEntry) Seq() uint64       { return e.seq }
+func (e fakeIpnsEntry) ValidityEOS() bool { return e.expired }
+
+func TestIpnsMergeReducerReduce(t *testing.T) {
+	decode := func(v []byte) (ipnsEntry, error) {
+		switch string(v) {
+		case "low":
+			return fakeIpnsEntry{seq: 1}, nil
+		case "high":
+			return fakeIpnsEntry{seq: 2}, nil
+		case "high-expired":
+			return fakeIpnsEntry{seq: 3, expired: true}, nil
+		default:
+			return nil, errors.New("bad entry")
+		}
+	}
+
+	r := IpnsMergeReducer{Decode: decode}
+
+	t.Run("selects the highest sequence number among unexpired entries", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{[]byte("low"), []byte("high"), []byte("garbage")})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != 1 {
+			t.Fatalf("expected index 1 (highest seq), got %d", idx)
+		}
+		if !bytes.Equal(out, []byte("high")) {
+			t.Fatalf("expected %q, got %q", "high", out)
+		}
+	})
+
+	t.Run("an unexpired entry beats a higher-sequence entry that already hit its validity end", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{[]byte("high-expired"), []byte("low")})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != 1 {
+			t.Fatalf("expected index 1 (unexpired), got %d", idx)
+		}
+		if !bytes.Equal(out, []byte("low")) {
+			t.Fatalf("expected %q, got %q", "low", out)
+		}
+	})
+
+	t.Run("falls back to the highest sequence number when every entry is expired", func(t *testing.T) {
+		_, idx, err := r.Reduce("k", [][]byte{[]byte("high-expired")})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != 0 {
+			t.Fatalf("expected index 0, got %d", idx)
+		}
+	})
+
+	if _, _, err := r.Reduce("k", [][]byte{[]byte("garbage")}); err == nil {
+		t.Fatal("expected an error when no value decodes")
+	}
+}
+
+// lwwCodec builds a Decode/Encode pair for LWWReducer that frames a VectorClock (via EncodeVectorClock, prefixed
+// with an entry count so it's self-delimiting) followed by the raw payload.
+func lwwCodec() (decode func([]byte) (VectorClock, []byte, error), encode func(VectorClock, []byte) ([]byte, error)) {
+	encode = func(vc VectorClock, payload []byte) ([]byte, error) {
+		tmp := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(tmp, uint64(len(vc)))
+		out := append([]byte{}, tmp[:n]...)
+		out = append(out, EncodeVectorClock(vc)...)
+		return append(out, payload...), nil
+	}
+
+	decode = func(v []byte) (VectorClock, []byte, error) {
+		count, n := binary.Uvarint(v)
+		if n <= 0 {
+			return nil, nil, errors.New("bad framing: clock count")
+		}
+		rest := v[n:]
+
+		vc := VectorClock{}
+		for i := uint64(0); i < count; i++ {
+			idLen, n := binary.Uvarint(rest)
+			if n <= 0 {
+				return nil, nil, errors.New("bad framing: id length")
+			}
+			rest = rest[n:]
+
+			id := string(rest[:idLen])
+			rest = rest[idLen:]
+
+			ts, n := binary.Uvarint(rest)
+			if n <= 0 {
+				return nil, nil, errors.New("bad framing: timestamp")
+			}
+			rest = rest[n:]
+
+			vc[id] = ts
+		}
+		return vc, rest, nil
+	}
+
+	return decode, encode
+}
+
+func TestLWWReducerReduce(t *testing.T) {
+	decode, encode := lwwCodec()
+	pick := func(_ []VectorClock, payloads [][]byte) []byte {
+		return payloads[len(payloads)-1]
+	}
+
+	r := LWWReducer{Decode: decode, Encode: encode, PickPayload: pick}
+
+	a, err := encode(VectorClock{"a": 1}, []byte("x"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := encode(VectorClock{"b": 1}, []byte("y"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	t.Run("merging divergent clocks produces a new value", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{a, b})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != -1 {
+			t.Fatalf("expected index -1, got %d", idx)
+		}
+		wantOut, err := encode(VectorClock{"a": 1, "b": 1}, []byte("y"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !bytes.Equal(out, wantOut) {
+			t.Fatalf("expected %q, got %q", wantOut, out)
+		}
+	})
+
+	t.Run("a single unchanged input round-trips to itself, not a spurious -1", func(t *testing.T) {
+		out, idx, err := r.Reduce("k", [][]byte{a})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if idx != 0 {
+			t.Fatalf("expected index 0 (unchanged round-trip), got %d", idx)
+		}
+		if !bytes.Equal(out, a) {
+			t.Fatalf("expected %q, got %q", a, out)
+		}
+	})
+}
+
+func TestEncodeVectorClockDeterministic(t *testing.T) {
+	vc := VectorClock{"z": 3, "a": 1, "m": 2}
+	first := EncodeVectorClock(vc)
+	for i := 0; i < 50; i++ {
+		if !bytes.Equal(first, EncodeVectorClock(vc)) {
+			t.Fatalf("EncodeVectorClock produced different output for the same clock on iteration %d", i)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package dht
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+// MaxRepairPutsDefault is used when the WithMaxRepairPuts option is not set.
+const MaxRepairPutsDefault = 6
+
+// WithMaxRepairPuts bounds how many peers a single repair-on-read PUT will
+// touch. Reducers that merge records (see the reducer package's
+// MergingReducer family) can report a fused value that matches none of the
+// inputs the DHT fetched during a GetValue/SearchValue quorum; without a
+// cap, repairing that value back to every superseded peer on every read
+// could turn a single lookup into an unbounded fan-out of PUTs.
+func WithMaxRepairPuts(n int) Option {
+	return func(dht *IpfsDHT) error {
+		dht.maxRepairPuts = n
+		return nil
+	}
+}
+
+// repairCandidate is a record that a quorum reduction in GetValue/SearchValue
+// found to disagree with the merged result.
+type repairCandidate struct {
+	from  peer.ID
+	value []byte
+}
+
+// repairOnRead PUTs the merged record back to every peer whose value was
+// superseded by it, stopping after dht.maxRepairPuts puts. It is called from
+// the quorum-processing loop in GetValue/SearchValue whenever a Reducer
+// returns -1, i.e. the reduced value is new rather than a selection among
+// the inputs.
+//
+// The puts themselves run in their own goroutine against dht.Context() rather than blocking the caller: tying them
+// to the context of the GetValue/SearchValue call that triggered the repair would mean up to maxRepairPuts
+// sequential network PUTs have to finish (or the caller's ctx has to survive) before the caller ever sees the merged
+// value it asked for. Repair is best-effort maintenance, not part of the read path, so it shouldn't make the caller
+// wait on it or die with it.
+func (dht *IpfsDHT) repairOnRead(key string, merged []byte, superseded []repairCandidate) {
+	max := dht.maxRepairPuts
+	if max <= 0 {
+		max = MaxRepairPutsDefault
+	}
+	if len(superseded) > max {
+		logger.Debugf("repair-on-read for key %s truncated to %d puts", key, max)
+		superseded = superseded[:max]
+	}
+
+	go func() {
+		repairCtx := dht.Context()
+		for _, c := range superseded {
+			if err := dht.putValueToPeer(repairCtx, c.from, key, merged); err != nil {
+				logger.Debugf("repair-on-read PUT to %s failed: %s", c.from, err)
+			}
+		}
+	}()
+}
+
+// putValueToPeer PUTs value to p along the DHT's normal put path: wrap it in a record.Record the same way any other
+// PutValue call does, and send it with the protoMessenger rather than hand-rolling a request.
+func (dht *IpfsDHT) putValueToPeer(ctx context.Context, p peer.ID, key string, value []byte) error {
+	rec := record.MakePutRecord(key, value)
+	return dht.protoMessenger.PutValue(ctx, p, rec)
+}
@@ -0,0 +1,85 @@
+package dht
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/routing"
+
+	kb "github.com/libp2p/go-libp2p-kbucket"
+)
+
+// defaultGetQuorum is how many of a key's closest peers GetValue/SearchValue wait to hear back from before folding
+// the answers through reduceAndRepair, when the caller doesn't pass routing.Quorum.
+const defaultGetQuorum = 16
+
+// GetValue searches for the value corresponding to the given key among its closest routing-table peers. It asks the
+// routing.Quorum closest of them once each and folds whatever values they return through reduceAndRepair -- which
+// runs them through dht.reducer and PUTs a merged value back to any peer whose answer was superseded -- instead of
+// taking a bare record.Validator.Select over the raw answers. A peer that fails or holds no value is skipped, not
+// replaced by a further peer.
+func (dht *IpfsDHT) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	vals, err := dht.getValues(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, routing.ErrNotFound
+	}
+
+	return dht.reduceAndRepair(key, vals)
+}
+
+// SearchValue is like GetValue, but streams the quorum-reduced answer back on a channel instead of blocking the
+// caller until it's ready, so callers that want to act on a first decent value don't have to wait any longer than
+// GetValue's own quorum wait.
+func (dht *IpfsDHT) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	out := make(chan []byte, 1)
+
+	go func() {
+		defer close(out)
+
+		vals, err := dht.getValues(ctx, key, opts...)
+		if err != nil || len(vals) == 0 {
+			return
+		}
+
+		merged, err := dht.reduceAndRepair(key, vals)
+		if err != nil {
+			return
+		}
+
+		select {
+		case out <- merged:
+		case <-ctx.Done():
+		}
+	}()
+
+	return out, nil
+}
+
+// getValues queries the routing.Quorum closest routing-table peers to key (defaultGetQuorum if unset) for their copy
+// of key via protoMessenger, and collects the values of whichever of them answer with one.
+func (dht *IpfsDHT) getValues(ctx context.Context, key string, opts ...routing.Option) ([]peerValue, error) {
+	var cfg routing.Options
+	if err := cfg.Apply(opts...); err != nil {
+		return nil, err
+	}
+
+	quorum := cfg.Quorum
+	if quorum <= 0 {
+		quorum = defaultGetQuorum
+	}
+
+	closest := dht.routingTable.NearestPeers(kb.ConvertKey(key), quorum)
+
+	vals := make([]peerValue, 0, len(closest))
+	for _, p := range closest {
+		rec, _, err := dht.protoMessenger.GetValue(ctx, p, key)
+		if err != nil || rec == nil {
+			continue
+		}
+		vals = append(vals, peerValue{from: p, value: rec.GetValue()})
+	}
+
+	return vals, nil
+}
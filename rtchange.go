@@ -0,0 +1,68 @@
+package dht
+
+import "github.com/libp2p/go-libp2p-core/peer"
+
+// chainPeerCallback returns a callback that runs prev (if non-nil) and then next, so a new kbucket.RoutingTable
+// PeerAdded/PeerRemoved hook can be installed without clobbering whatever the table already had wired in (e.g.
+// metrics).
+func chainPeerCallback(prev, next func(peer.ID)) func(peer.ID) {
+	return func(p peer.ID) {
+		if prev != nil {
+			prev(p)
+		}
+		next(p)
+	}
+}
+
+// rtChangeCoalescer debounces bursts of routing-table mutations into a single emit call. PeerAdded/PeerRemoved fire
+// on every connection churn event -- on a busy server-mode node with a full table, that's the connection hot path --
+// but emit (EvtDHTRoutingTableChanged's bucketCount recompute, an O(n) walk of the table) only needs to run once per
+// burst, not once per mutation, since subscribers only care about the table's resulting shape.
+//
+// trigger is safe to call from any number of goroutines and never blocks: it's a non-blocking send on a
+// capacity-1 channel, so a trigger that arrives while another is already queued is silently coalesced with it
+// instead of queuing a redundant call. A trigger that arrives while emit is running queues one follow-up call.
+type rtChangeCoalescer struct {
+	emit   func()
+	signal chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newRTChangeCoalescer(emit func()) *rtChangeCoalescer {
+	c := &rtChangeCoalescer{
+		emit:   emit,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+func (c *rtChangeCoalescer) run() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.signal:
+			c.emit()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// trigger requests an emit, coalescing with any other request that hasn't been picked up by the worker yet.
+func (c *rtChangeCoalescer) trigger() {
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the worker and waits for it to exit, so a caller that closes the emitters emit writes to right after
+// close returning (as subscribe's defers do) can't race an in-flight emit against that Close.
+func (c *rtChangeCoalescer) close() {
+	close(c.stop)
+	<-c.done
+}
@@ -0,0 +1,104 @@
+package dht
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestChainPeerCallbackRunsPrevThenNext(t *testing.T) {
+	var order []string
+
+	prev := func(p peer.ID) { order = append(order, "prev:"+string(p)) }
+	next := func(p peer.ID) { order = append(order, "next:"+string(p)) }
+
+	chained := chainPeerCallback(prev, next)
+	chained(peer.ID("p1"))
+
+	if len(order) != 2 || order[0] != "prev:p1" || order[1] != "next:p1" {
+		t.Fatalf("expected prev then next, got %v", order)
+	}
+}
+
+func TestChainPeerCallbackToleratesNilPrev(t *testing.T) {
+	var called bool
+	next := func(p peer.ID) { called = true }
+
+	chained := chainPeerCallback(nil, next)
+	chained(peer.ID("p1"))
+
+	if !called {
+		t.Fatal("expected next to run even when prev is nil")
+	}
+}
+
+func TestRTChangeCoalescerRunsEmitForASingleTrigger(t *testing.T) {
+	var calls atomic.Int64
+
+	c := newRTChangeCoalescer(func() { calls.Add(1) })
+	defer c.close()
+
+	c.trigger()
+
+	if !waitForCount(&calls, 1) {
+		t.Fatalf("expected emit to run once, got %d", calls.Load())
+	}
+}
+
+// TestRTChangeCoalescerCoalescesBurstsOfTriggers is the regression test for the review finding: bucketCount's O(n)
+// walk must not run once per PeerAdded/PeerRemoved callback. It fires many triggers faster than a slow emit can
+// drain them and asserts the coalescer collapsed them into far fewer than it received.
+func TestRTChangeCoalescerCoalescesBurstsOfTriggers(t *testing.T) {
+	var calls atomic.Int64
+	started := make(chan struct{}, 1)
+
+	c := newRTChangeCoalescer(func() {
+		calls.Add(1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+	defer c.close()
+
+	const triggers = 50
+	for i := 0; i < triggers; i++ {
+		c.trigger()
+	}
+
+	// let the in-flight (or about-to-start) emit finish, plus any single coalesced follow-up.
+	<-started
+	time.Sleep(100 * time.Millisecond)
+
+	if got := calls.Load(); got < 1 || got >= triggers {
+		t.Fatalf("expected the burst of %d triggers to coalesce into a handful of emits, got %d", triggers, got)
+	}
+}
+
+func TestRTChangeCoalescerStopsOnClose(t *testing.T) {
+	var calls atomic.Int64
+
+	c := newRTChangeCoalescer(func() { calls.Add(1) })
+	c.close()
+
+	c.trigger()
+	time.Sleep(20 * time.Millisecond)
+
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("expected no emits after close, got %d", got)
+	}
+}
+
+func waitForCount(counter *atomic.Int64, n int64) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if counter.Load() >= n {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return counter.Load() >= n
+}
@@ -2,6 +2,8 @@ package dht
 
 import (
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -9,6 +11,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 
 	"github.com/libp2p/go-eventbus"
+	kb "github.com/libp2p/go-libp2p-kbucket"
 
 	ma "github.com/multiformats/go-multiaddr"
 
@@ -21,6 +24,31 @@ import (
 type subscriberNotifee struct {
 	dht  *IpfsDHT
 	subs event.Subscription
+
+	// reachHistory and reachTimer back the ModePolicy evaluation in handleLocalReachabilityChangedEvent; they're
+	// only touched from the single-threaded subscribe loop below, so no lock is needed. reachGen is the exception:
+	// it's also read from the reachTimer's own callback goroutine, which runs concurrently with the subscribe loop.
+	reachHistory []ReachabilitySample
+	reachTimer   *time.Timer
+	reachGen     atomic.Uint64
+
+	modeEmitter event.Emitter
+
+	// rtPeerAddedEmitter, rtPeerRemovedEmitter and rtChangedEmitter are nil unless the DHT was constructed with
+	// WithRoutingTableEvents(true), in which case they're wired into the routing table's PeerAdded/PeerRemoved
+	// callbacks below so subscribers pay nothing when they don't opt in.
+	rtPeerAddedEmitter   event.Emitter
+	rtPeerRemovedEmitter event.Emitter
+	rtChangedEmitter     event.Emitter
+
+	// rtChangeCoalescer debounces the EvtDHTRoutingTableChanged recompute (bucketCount is an O(n) table walk) so it
+	// runs once per burst of PeerAdded/PeerRemoved callbacks rather than once per callback. Nil unless
+	// rtChangedEmitter is set.
+	rtChangeCoalescer *rtChangeCoalescer
+
+	// msInvalidator drains messageSender invalidation jobs queued by Disconnected and invalidateMessageSender on a
+	// bounded worker pool instead of one goroutine per job.
+	msInvalidator *msInvalidator
 }
 
 func newSubscriberNotifiee(dht *IpfsDHT) (*subscriberNotifee, error) {
@@ -50,9 +78,43 @@ func newSubscriberNotifiee(dht *IpfsDHT) (*subscriberNotifee, error) {
 		return nil, fmt.Errorf("dht could not subscribe to eventbus events; err: %s", err)
 	}
 
+	modeEmitter, err := dht.host.EventBus().Emitter(new(EvtDHTModeChanged))
+	if err != nil {
+		return nil, fmt.Errorf("dht could not create mode-changed emitter; err: %s", err)
+	}
+
+	if dht.modePolicy == nil {
+		dht.modePolicy = HysteresisPolicy{N: 3, MinPublicDuration: 2 * time.Minute, MinPrivateDuration: 30 * time.Second}
+	}
+
 	nn := &subscriberNotifee{
-		dht:  dht,
-		subs: subs,
+		dht:         dht,
+		subs:        subs,
+		modeEmitter: modeEmitter,
+	}
+	nn.msInvalidator = newMsInvalidator(dht)
+
+	if dht.routingTableEvents {
+		if nn.rtPeerAddedEmitter, err = dht.host.EventBus().Emitter(new(EvtDHTRoutingTablePeerAdded), eventbus.BufSize(256)); err != nil {
+			return nil, fmt.Errorf("dht could not create routing-table-peer-added emitter; err: %s", err)
+		}
+		if nn.rtPeerRemovedEmitter, err = dht.host.EventBus().Emitter(new(EvtDHTRoutingTablePeerRemoved), eventbus.BufSize(256)); err != nil {
+			return nil, fmt.Errorf("dht could not create routing-table-peer-removed emitter; err: %s", err)
+		}
+		if nn.rtChangedEmitter, err = dht.host.EventBus().Emitter(new(EvtDHTRoutingTableChanged), eventbus.BufSize(256)); err != nil {
+			return nil, fmt.Errorf("dht could not create routing-table-changed emitter; err: %s", err)
+		}
+
+		nn.rtChangeCoalescer = newRTChangeCoalescer(nn.emitRoutingTableChanged)
+
+		// chain onto whatever the routing table's callbacks already do (e.g. metrics) rather than replacing them.
+		prevAdded, prevRemoved := dht.routingTable.PeerAdded, dht.routingTable.PeerRemoved
+		dht.routingTable.PeerAdded = chainPeerCallback(prevAdded, func(p peer.ID) {
+			nn.emitPeerEvent(nn.rtPeerAddedEmitter, EvtDHTRoutingTablePeerAdded{Peer: p})
+		})
+		dht.routingTable.PeerRemoved = chainPeerCallback(prevRemoved, func(p peer.ID) {
+			nn.emitPeerEvent(nn.rtPeerRemovedEmitter, EvtDHTRoutingTablePeerRemoved{Peer: p})
+		})
 	}
 
 	// register for network notifications
@@ -72,6 +134,25 @@ func (nn *subscriberNotifee) subscribe(proc goprocess.Process) {
 	dht := nn.dht
 	defer dht.host.Network().StopNotify(nn)
 	defer nn.subs.Close()
+	defer nn.modeEmitter.Close()
+	defer func() {
+		for _, e := range []event.Emitter{nn.rtPeerAddedEmitter, nn.rtPeerRemovedEmitter, nn.rtChangedEmitter} {
+			if e != nil {
+				e.Close()
+			}
+		}
+	}()
+	defer func() {
+		if nn.rtChangeCoalescer != nil {
+			nn.rtChangeCoalescer.close()
+		}
+	}()
+	defer func() {
+		if nn.reachTimer != nil {
+			nn.reachTimer.Stop()
+		}
+	}()
+	defer nn.msInvalidator.close()
 
 	for {
 		select {
@@ -92,12 +173,12 @@ func (nn *subscriberNotifee) subscribe(proc goprocess.Process) {
 				default:
 				}
 			case event.EvtPeerProtocolsUpdated:
-				handlePeerProtocolsUpdatedEvent(dht, evt)
+				nn.handlePeerProtocolsUpdatedEvent(evt)
 			case event.EvtPeerIdentificationCompleted:
 				handlePeerIdentificationCompletedEvent(dht, evt)
 			case event.EvtLocalReachabilityChanged:
 				if dht.auto {
-					handleLocalReachabilityChangedEvent(dht, evt)
+					nn.handleLocalReachabilityChangedEvent(evt)
 				} else {
 					// something has gone really wrong if we get an event we did not subscribe to
 					logger.Errorf("received LocalReachabilityChanged event that was not subscribed to")
@@ -112,6 +193,12 @@ func (nn *subscriberNotifee) subscribe(proc goprocess.Process) {
 	}
 }
 
+// handlePeerIdentificationCompletedEvent fires both for a peer's initial
+// identification and for a later Identify push (e.g. a refreshed signed peer
+// record). Identify persists whatever it learned to the peerstore before
+// emitting this event, so by the time we read addresses below via
+// dht.peerFound they already reflect the push -- we don't need to special
+// case push vs. pull here beyond that ordering guarantee.
 func handlePeerIdentificationCompletedEvent(dht *IpfsDHT, e event.EvtPeerIdentificationCompleted) {
 	dht.plk.Lock()
 	defer dht.plk.Unlock()
@@ -130,7 +217,53 @@ func handlePeerIdentificationCompletedEvent(dht *IpfsDHT, e event.EvtPeerIdentif
 	}
 }
 
-func handlePeerProtocolsUpdatedEvent(dht *IpfsDHT, e event.EvtPeerProtocolsUpdated) {
+// handlePeerProtocolsUpdatedEvent reacts to an Identify push that changed the
+// set of protocols a connected peer speaks. Unlike the initial
+// EvtPeerIdentificationCompleted, this can fire at any point in a peer's
+// lifetime, so we act on the Added/Removed deltas first, and consult the
+// peerstore (validRTPeer) only before evicting or when no DHT protocol is in
+// either delta.
+func (nn *subscriberNotifee) handlePeerProtocolsUpdatedEvent(e event.EvtPeerProtocolsUpdated) {
+	dht := nn.dht
+
+	removedDHT := dht.protocolsContain(e.Removed)
+	if removedDHT {
+		// a DHT protocol was removed. Do this before looking at Added: even if the peer added a different DHT
+		// protocol in the same push (e.g. a version upgrade from v1 to v2), any cached messageSender was negotiated
+		// on a protocol ID it may no longer speak, so drop it now instead of leaving it in dht.strmap until some
+		// later call happens to notice it's stale.
+		nn.invalidateMessageSender(e.Peer)
+	}
+
+	if dht.protocolsContain(e.Added) {
+		// the peer gained DHT protocol support (or kept it across the version swap above); get it into the routing
+		// table right away rather than waiting for the next query to notice.
+		dht.plk.Lock()
+		dht.peerFound(dht.ctx, e.Peer, false)
+		dht.plk.Unlock()
+		dht.fixRTIfNeeded()
+		return
+	}
+
+	if removedDHT {
+		// the peer dropped DHT protocol support without adding a replacement in the same push, but it may still
+		// speak another DHT protocol we accept that this delta didn't mention: check the post-event peerstore state
+		// the same way the no-delta-matched branch below does before evicting, instead of trusting the delta alone.
+		valid, err := dht.validRTPeer(e.Peer)
+		if err != nil {
+			logger.Errorf("could not check peerstore for protocol support: err: %s", err)
+			return
+		}
+		if !valid {
+			// the peer dropped DHT protocol support mid-session; evict it now instead of waiting for a query
+			// against it to fail.
+			dht.peerStoppedDHT(dht.ctx, e.Peer)
+		}
+		return
+	}
+
+	// the update didn't touch any protocol we care about; re-check in case
+	// the peer's overall protocol support now makes it routing-table eligible.
 	valid, err := dht.validRTPeer(e.Peer)
 	if err != nil {
 		logger.Errorf("could not check peerstore for protocol support: err: %s", err)
@@ -146,25 +279,135 @@ func handlePeerProtocolsUpdatedEvent(dht *IpfsDHT, e event.EvtPeerProtocolsUpdat
 	dht.fixRTIfNeeded()
 }
 
-func handleLocalReachabilityChangedEvent(dht *IpfsDHT, e event.EvtLocalReachabilityChanged) {
-	var target mode
+// protocolsContain reports whether any of the given protocol IDs is one of
+// the DHT's own protocols.
+func (dht *IpfsDHT) protocolsContain(protos []protocol.ID) bool {
+	for _, p := range protos {
+		for _, dhtProto := range dht.protocols {
+			if p == dhtProto {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// invalidateMessageSender drops the cached messageSender for p, if any, so
+// the next call to dht.messageSenderForPeer opens a fresh stream instead of
+// reusing one negotiated on a protocol the peer no longer speaks. The actual
+// invalidation is handed off to nn.msInvalidator rather than done inline, for
+// the same reason Disconnected does: ms.lk can block for a while, and this
+// can fire for many peers at once on a wide Identify push.
+func (nn *subscriberNotifee) invalidateMessageSender(p peer.ID) {
+	dht := nn.dht
 
-	switch e.Reachability {
-	case network.ReachabilityPrivate, network.ReachabilityUnknown:
-		target = modeClient
-	case network.ReachabilityPublic:
-		target = modeServer
+	dht.smlk.Lock()
+	ms, ok := dht.strmap[p]
+	if ok {
+		delete(dht.strmap, p)
+	}
+	dht.smlk.Unlock()
+
+	if !ok {
+		return
 	}
 
-	logger.Infof("processed event %T; performing dht mode switch", e)
+	nn.msInvalidator.enqueue(p, ms)
+}
+
+// handleLocalReachabilityChangedEvent records the observation, consults the DHT's ModePolicy for a target mode and a
+// delay, and schedules (or cancels a previously scheduled) transition accordingly. It must only be called from the
+// subscribe loop so that reachHistory/reachTimer don't need their own lock.
+func (nn *subscriberNotifee) handleLocalReachabilityChangedEvent(e event.EvtLocalReachabilityChanged) {
+	dht := nn.dht
+
+	nn.reachHistory = append(nn.reachHistory, ReachabilitySample{Reachability: e.Reachability, At: time.Now()})
+	// bound the history so a long-lived node doesn't grow this forever; the policy only ever needs a trailing run.
+	if max := 64; len(nn.reachHistory) > max {
+		nn.reachHistory = nn.reachHistory[len(nn.reachHistory)-max:]
+	}
+
+	// Bump the generation before touching reachTimer: Stop's return value doesn't tell us whether the old timer's
+	// callback has already started running, so a callback that's already past this point needs its own way to
+	// notice it's been superseded instead of applying a transition decided on now-stale history.
+	gen := nn.reachGen.Add(1)
+	if nn.reachTimer != nil {
+		nn.reachTimer.Stop()
+		nn.reachTimer = nil
+	}
+
+	current := dht.getMode()
+	target, delay := dht.modePolicy.Decide(current, e, nn.reachHistory)
+	if target == current {
+		return
+	}
+
+	if delay <= 0 {
+		nn.applyModeTransition(current, target)
+		return
+	}
+
+	logger.Infof("dht mode transition to %d scheduled in %s", target, delay)
+	nn.reachTimer = time.AfterFunc(delay, func() {
+		if nn.reachGen.Load() != gen {
+			// a later reachability observation superseded this decision before it fired.
+			return
+		}
+		nn.applyModeTransition(current, target)
+	})
+}
+
+// applyModeTransition performs the actual client/server switch and emits EvtDHTModeChanged on success.
+func (nn *subscriberNotifee) applyModeTransition(from, target Mode) {
+	dht := nn.dht
 
 	err := dht.setMode(target)
 	// NOTE: the mode will be printed out as a decimal.
-	if err == nil {
-		logger.Infow("switched DHT mode successfully", "mode", target)
-	} else {
+	if err != nil {
 		logger.Errorw("switching DHT mode failed", "mode", target, "error", err)
+		return
+	}
+
+	logger.Infow("switched DHT mode successfully", "mode", target)
+	if err := nn.modeEmitter.Emit(EvtDHTModeChanged{From: from, To: target}); err != nil {
+		logger.Errorf("failed to emit EvtDHTModeChanged: %s", err)
+	}
+}
+
+// emitPeerEvent emits evt (an EvtDHTRoutingTablePeerAdded or EvtDHTRoutingTablePeerRemoved) on emitter and triggers a
+// debounced EvtDHTRoutingTableChanged recompute. It's called directly on the routing table's PeerAdded/PeerRemoved
+// callbacks, so it must stay cheap: the Changed event's bucketCount is an O(n) table walk, which is why it's handed
+// off to rtChangeCoalescer instead of recomputed here on every single mutation.
+func (nn *subscriberNotifee) emitPeerEvent(emitter event.Emitter, evt interface{}) {
+	if err := emitter.Emit(evt); err != nil {
+		logger.Errorf("failed to emit %T: %s", evt, err)
 	}
+	nn.rtChangeCoalescer.trigger()
+}
+
+// emitRoutingTableChanged emits an EvtDHTRoutingTableChanged carrying the table's current size and bucket count, so
+// a subscriber that only cares about aggregate shape doesn't have to track individual peers itself. It's run by
+// rtChangeCoalescer's worker goroutine, never directly off a PeerAdded/PeerRemoved callback.
+func (nn *subscriberNotifee) emitRoutingTableChanged() {
+	if err := nn.rtChangedEmitter.Emit(EvtDHTRoutingTableChanged{
+		Size:    nn.dht.routingTable.Size(),
+		Buckets: nn.dht.bucketCount(),
+	}); err != nil {
+		logger.Errorf("failed to emit EvtDHTRoutingTableChanged: %s", err)
+	}
+}
+
+// bucketCount approximates the routing table's active bucket count by counting the distinct common-prefix lengths
+// among its current peers. go-libp2p-kbucket's bucket slice is unexported with no public count, so this recomputes
+// the same CPL-based partitioning the table itself buckets peers by, rather than reaching into its internals.
+func (dht *IpfsDHT) bucketCount() int {
+	self := kb.ConvertPeerID(dht.self)
+
+	cpls := make(map[int]struct{})
+	for _, p := range dht.routingTable.ListPeers() {
+		cpls[kb.CommonPrefixLen(self, kb.ConvertPeerID(p))] = struct{}{}
+	}
+	return len(cpls)
 }
 
 // validRTPeer returns true if the peer supports the DHT protocol and false otherwise. Supporting the DHT protocol means
@@ -206,14 +449,9 @@ func (nn *subscriberNotifee) Disconnected(n network.Network, v network.Conn) {
 	}
 	delete(dht.strmap, p)
 
-	// Do this asynchronously as ms.lk can block for a while.
-	go func() {
-		if err := ms.lk.Lock(dht.Context()); err != nil {
-			return
-		}
-		defer ms.lk.Unlock()
-		ms.invalidate()
-	}()
+	// Hand off to the worker pool instead of spawning a goroutine here: ms.lk can block for a while, and a
+	// reconnect storm can disconnect thousands of peers in a burst.
+	nn.msInvalidator.enqueue(p, ms)
 }
 
 func (nn *subscriberNotifee) Connected(n network.Network, v network.Conn)      {}
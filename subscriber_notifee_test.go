@@ -0,0 +1,29 @@
+package dht
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+func TestProtocolsContain(t *testing.T) {
+	dht := &IpfsDHT{protocols: []protocol.ID{"/ipfs/kad/1.0.0", "/ipfs/kad/2.0.0"}}
+
+	t.Run("reports true when one of the given protocols is one of the DHT's own", func(t *testing.T) {
+		if !dht.protocolsContain([]protocol.ID{"/other/1.0.0", "/ipfs/kad/1.0.0"}) {
+			t.Fatal("expected a match on /ipfs/kad/1.0.0")
+		}
+	})
+
+	t.Run("reports false when none of the given protocols match", func(t *testing.T) {
+		if dht.protocolsContain([]protocol.ID{"/other/1.0.0"}) {
+			t.Fatal("expected no match")
+		}
+	})
+
+	t.Run("reports false for an empty delta", func(t *testing.T) {
+		if dht.protocolsContain(nil) {
+			t.Fatal("expected no match on an empty delta")
+		}
+	})
+}